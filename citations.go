@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var extractCitationsFlag = flag.Bool("extract-citations", false, "parse mirror/*.xml Akoma Ntoso files into acts.jsonl and citations.tsv instead of crawling")
+
+const (
+	actsFile      = "acts.jsonl"
+	citationsFile = "citations.tsv"
+)
+
+// akomaNtoso is a deliberately partial mapping of the Fedlex Akoma Ntoso
+// schema: just enough of <meta>/<body>/<references> to build an act record
+// and its citation edges, not a general-purpose Akoma Ntoso model.
+type akomaNtoso struct {
+	XMLName xml.Name `xml:"akomaNtoso"`
+	Act     struct {
+		Meta struct {
+			Identification struct {
+				FRBRWork struct {
+					FRBRthis struct {
+						Value string `xml:"value,attr"`
+					} `xml:"FRBRthis"`
+					FRBRdate struct {
+						Date string `xml:"date,attr"`
+						Name string `xml:"name,attr"`
+					} `xml:"FRBRdate"`
+					FRBRauthor struct {
+						Href string `xml:"href,attr"`
+					} `xml:"FRBRauthor"`
+				} `xml:"FRBRWork"`
+				FRBRExpression struct {
+					FRBRlanguage struct {
+						Language string `xml:"language,attr"`
+					} `xml:"FRBRlanguage"`
+				} `xml:"FRBRExpression"`
+			} `xml:"identification"`
+			References struct {
+				TLCOrganizations []struct {
+					Eid    string `xml:"eId,attr"`
+					ShowAs string `xml:"showAs,attr"`
+				} `xml:"TLCOrganization"`
+			} `xml:"references"`
+		} `xml:"meta"`
+		Preface struct {
+			DocTitles []struct {
+				Lang string `xml:"lang,attr,omitempty"`
+				Text string `xml:",chardata"`
+			} `xml:"docTitle"`
+		} `xml:"preface"`
+		Body struct {
+			Articles []struct {
+				Eid     string `xml:"eId,attr"`
+				Num     string `xml:"num"`
+				Heading string `xml:"heading"`
+				// InnerXML keeps the raw markup of the article body so
+				// refCitationEdges can regex-scan it for <ref>/<mref>
+				// citations without a full Akoma Ntoso content model.
+				InnerXML string `xml:",innerxml"`
+			} `xml:"article"`
+		} `xml:"body"`
+		Analysis struct {
+			ActiveModifications []struct {
+				Type   string `xml:"type,attr"`
+				Source struct {
+					Href string `xml:"href,attr"`
+				} `xml:"source"`
+				Destination struct {
+					Href string `xml:"href,attr"`
+				} `xml:"destination"`
+			} `xml:"activeModifications>textualMod"`
+		} `xml:"analysis"`
+	} `xml:"act"`
+}
+
+// ActRecord is the normalized, language-agnostic view of one act that gets
+// written to acts.jsonl, one JSON object per line.
+type ActRecord struct {
+	ELI               string            `json:"eli"`
+	Titles            map[string]string `json:"titles"` // BCP-47-ish lang code -> title
+	InForceDate       string            `json:"in_force_date,omitempty"`
+	EnactingAuthority string            `json:"enacting_authority,omitempty"`
+	Articles          []ArticleRecord   `json:"articles,omitempty"`
+}
+
+// ArticleRecord is one <article> within an act's body.
+type ArticleRecord struct {
+	Eid     string `json:"eid"`
+	Num     string `json:"num,omitempty"`
+	Heading string `json:"heading,omitempty"`
+}
+
+// modificationCitationType maps the Akoma Ntoso textualMod/type attribute
+// onto the edge types citations.tsv records.
+var modificationCitationType = map[string]string{
+	"substitution": "amends",
+	"repeal":       "repealed by",
+	"insertion":    "amends",
+}
+
+// refHrefPattern matches the href of an in-body <ref>/<mref> element, e.g.
+// <ref href="/eli/treaty/...">...</ref> or <ref href="#art_3">...</ref>.
+// Akoma Ntoso allows attribute order to vary, so this only anchors on the
+// element name and grabs the first href it finds.
+var refHrefPattern = regexp.MustCompile(`<m?ref\b[^>]*\bhref="([^"]+)"`)
+
+// classifyReference labels an in-body <ref>/<mref> href by what it points
+// to: a treaty (the "implements treaty" edge the request asked for), an
+// in-document article (article-to-article citation), another act, or,
+// failing those, a generic citation.
+func classifyReference(href string) string {
+	switch {
+	case strings.Contains(href, "/eli/treaty/"):
+		return "implements treaty"
+	case strings.HasPrefix(href, "#"):
+		return "cites article"
+	case strings.Contains(href, "/eli/"):
+		return "cites act"
+	default:
+		return "cites"
+	}
+}
+
+// refCitationEdges scans an article's raw body markup for <ref>/<mref>
+// citations and returns one typed edge per occurrence, sourced from the
+// article's own eId (scoped to the act's ELI) rather than the act as a
+// whole, since these are article-level citations.
+func refCitationEdges(eli, articleEid, innerXML string) []CitationEdge {
+	source := eli
+	if articleEid != "" {
+		source = eli + "#" + articleEid
+	}
+
+	var edges []CitationEdge
+	for _, m := range refHrefPattern.FindAllStringSubmatch(innerXML, -1) {
+		href := m[1]
+		edges = append(edges, CitationEdge{
+			Source: source,
+			Target: href,
+			Type:   classifyReference(href),
+		})
+	}
+	return edges
+}
+
+// runCitationExtraction walks mirror/ for .xml files, parsing each as Akoma
+// Ntoso. Fedlex serves each language as its own expression file sharing the
+// same work-level ELI, so per-file records are merged by ELI into one
+// combined record (DE/FR/IT/RM/EN titles and all) before a single line per
+// act is written to actsFile; citation edges are written as they're found.
+func runCitationExtraction() error {
+	citationsFd, err := os.Create(citationsFile)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", citationsFile, err)
+	}
+	defer citationsFd.Close()
+	citationsW := bufio.NewWriter(citationsFd)
+	defer citationsW.Flush()
+
+	acts := make(map[string]*ActRecord)
+	var eliOrder []string
+	var edgeCount int
+
+	err = filepath.Walk("mirror", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".xml") {
+			return err
+		}
+
+		record, edges, err := extractAct(path)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", path, err)
+			return nil
+		}
+		mergeActRecord(acts, &eliOrder, record)
+
+		for _, e := range edges {
+			fmt.Fprintf(citationsW, "%s\t%s\t%s\n", e.Source, e.Target, e.Type)
+			edgeCount++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	actsFd, err := os.Create(actsFile)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", actsFile, err)
+	}
+	defer actsFd.Close()
+	actsW := bufio.NewWriter(actsFd)
+	defer actsW.Flush()
+
+	for _, eli := range eliOrder {
+		line, err := json.Marshal(acts[eli])
+		if err != nil {
+			return err
+		}
+		actsW.Write(line)
+		actsW.WriteString("\n")
+	}
+
+	fmt.Printf("Extracted %d acts and %d citation edges\n", len(eliOrder), edgeCount)
+	return nil
+}
+
+// mergeActRecord folds record into acts[record.ELI], creating the entry (and
+// recording its output order in eliOrder) on first sight of that ELI.
+// Titles merge across language expressions; the other fields are filled in
+// from whichever expression file first carried a non-empty value.
+func mergeActRecord(acts map[string]*ActRecord, eliOrder *[]string, record ActRecord) {
+	existing, ok := acts[record.ELI]
+	if !ok {
+		acts[record.ELI] = &record
+		*eliOrder = append(*eliOrder, record.ELI)
+		return
+	}
+
+	for lang, title := range record.Titles {
+		existing.Titles[lang] = title
+	}
+	if existing.InForceDate == "" {
+		existing.InForceDate = record.InForceDate
+	}
+	if existing.EnactingAuthority == "" {
+		existing.EnactingAuthority = record.EnactingAuthority
+	}
+	if len(existing.Articles) == 0 {
+		existing.Articles = record.Articles
+	}
+}
+
+// CitationEdge is one typed edge in the citation graph, distinct from the
+// raw hyperlink edges in edges.tsv/digest.json.snappy.
+type CitationEdge struct {
+	Source, Target, Type string
+}
+
+// extractAct parses one Akoma Ntoso XML file into its ActRecord and the
+// citation edges it declares against other acts/articles.
+func extractAct(path string) (ActRecord, []CitationEdge, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ActRecord{}, nil, err
+	}
+
+	var doc akomaNtoso
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return ActRecord{}, nil, err
+	}
+
+	eli := doc.Act.Meta.Identification.FRBRWork.FRBRthis.Value
+	if eli == "" {
+		return ActRecord{}, nil, fmt.Errorf("no FRBRthis/ELI found")
+	}
+
+	record := ActRecord{
+		ELI:         eli,
+		Titles:      make(map[string]string),
+		InForceDate: doc.Act.Meta.Identification.FRBRWork.FRBRdate.Date,
+	}
+	if len(doc.Act.Meta.References.TLCOrganizations) > 0 {
+		record.EnactingAuthority = doc.Act.Meta.References.TLCOrganizations[0].ShowAs
+	}
+
+	lang := doc.Act.Meta.Identification.FRBRExpression.FRBRlanguage.Language
+	for _, t := range doc.Act.Preface.DocTitles {
+		l := t.Lang
+		if l == "" {
+			l = lang
+		}
+		record.Titles[l] = strings.TrimSpace(t.Text)
+	}
+
+	var edges []CitationEdge
+	for _, a := range doc.Act.Body.Articles {
+		record.Articles = append(record.Articles, ArticleRecord{
+			Eid:     a.Eid,
+			Num:     a.Num,
+			Heading: a.Heading,
+		})
+		edges = append(edges, refCitationEdges(eli, a.Eid, a.InnerXML)...)
+	}
+
+	for _, mod := range doc.Act.Analysis.ActiveModifications {
+		citationType, ok := modificationCitationType[mod.Type]
+		if !ok || mod.Source.Href == "" || mod.Destination.Href == "" {
+			continue
+		}
+		edges = append(edges, CitationEdge{
+			Source: mod.Source.Href,
+			Target: mod.Destination.Href,
+			Type:   citationType,
+		})
+	}
+
+	return record, edges, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyReference(t *testing.T) {
+	cases := []struct {
+		href string
+		want string
+	}{
+		{"/eli/treaty/2019/123/en", "implements treaty"},
+		{"#art_3", "cites article"},
+		{"/eli/cc/2020/1/de", "cites act"},
+		{"https://example.org/whatever", "cites"},
+	}
+	for _, c := range cases {
+		if got := classifyReference(c.href); got != c.want {
+			t.Errorf("classifyReference(%q) = %q, want %q", c.href, got, c.want)
+		}
+	}
+}
+
+func TestRefCitationEdges(t *testing.T) {
+	innerXML := `<p>See <ref href="#art_5">Art. 5</ref> and the
+		<ref href="/eli/treaty/2019/123/en">treaty</ref>.</p>`
+
+	edges := refCitationEdges("/eli/cc/2020/1/de", "art_1", innerXML)
+	if len(edges) != 2 {
+		t.Fatalf("got %d edges, want 2: %+v", len(edges), edges)
+	}
+	if edges[0].Source != "/eli/cc/2020/1/de#art_1" || edges[0].Target != "#art_5" || edges[0].Type != "cites article" {
+		t.Errorf("edge 0 = %+v", edges[0])
+	}
+	if edges[1].Target != "/eli/treaty/2019/123/en" || edges[1].Type != "implements treaty" {
+		t.Errorf("edge 1 = %+v", edges[1])
+	}
+}
+
+// TestMergeActRecord exercises the DE/FR-expression merge: two per-file
+// records sharing an ELI must fold into one record carrying both titles.
+func TestMergeActRecord(t *testing.T) {
+	acts := make(map[string]*ActRecord)
+	var eliOrder []string
+
+	de := ActRecord{
+		ELI:               "/eli/cc/2020/1",
+		Titles:            map[string]string{"de": "Bundesgesetz"},
+		InForceDate:       "2020-01-01",
+		EnactingAuthority: "Bundesversammlung",
+		Articles:          []ArticleRecord{{Eid: "art_1", Num: "1"}},
+	}
+	fr := ActRecord{
+		ELI:    "/eli/cc/2020/1",
+		Titles: map[string]string{"fr": "Loi fédérale"},
+	}
+
+	mergeActRecord(acts, &eliOrder, de)
+	mergeActRecord(acts, &eliOrder, fr)
+
+	if len(eliOrder) != 1 || eliOrder[0] != "/eli/cc/2020/1" {
+		t.Fatalf("eliOrder = %v, want exactly one entry", eliOrder)
+	}
+
+	got := acts["/eli/cc/2020/1"]
+	wantTitles := map[string]string{"de": "Bundesgesetz", "fr": "Loi fédérale"}
+	if !reflect.DeepEqual(got.Titles, wantTitles) {
+		t.Errorf("Titles = %v, want %v", got.Titles, wantTitles)
+	}
+	if got.InForceDate != "2020-01-01" {
+		t.Errorf("InForceDate = %q, want 2020-01-01", got.InForceDate)
+	}
+	if got.EnactingAuthority != "Bundesversammlung" {
+		t.Errorf("EnactingAuthority = %q, want Bundesversammlung", got.EnactingAuthority)
+	}
+	if len(got.Articles) != 1 || got.Articles[0].Eid != "art_1" {
+		t.Errorf("Articles = %+v, want one article art_1", got.Articles)
+	}
+}
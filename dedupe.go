@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var dedupeFlag = flag.Bool("dedupe", false, "store mirrored pages content-addressed under blobs/, with mirror/ as symlinks")
+
+const (
+	blobsDir      = "blobs"
+	blobIndexFile = "blob-index.tsv" // url \t sha256
+	blobMetaFile  = "blob-meta.tsv"  // sha256 \t baseSha256 (empty if stored raw)
+)
+
+// ContentAddressedStorage is the -dedupe Storage backend: each response
+// body is hashed with SHA256 and written once under
+// blobs/<sha256[:2]>/<sha256>; mirror/<path> becomes a symlink into the
+// blob store instead of holding a second copy. Near-duplicate blobs that
+// share a language/act-family prefix are stored as a zstd-compressed
+// common-prefix/common-suffix delta against the family's first blob to
+// shrink the mirror further.
+type ContentAddressedStorage struct {
+	mu         sync.Mutex
+	index      map[string]string // url -> sha256
+	familyBase map[string]string // family key -> sha256 of the first blob seen
+	meta       map[string]string // sha256 -> baseSha256 (delta-encoded blobs only)
+	indexFd    *os.File
+	metaFd     *os.File
+}
+
+func newContentAddressedStorage() *ContentAddressedStorage {
+	s := &ContentAddressedStorage{
+		index:      make(map[string]string),
+		familyBase: make(map[string]string),
+		meta:       make(map[string]string),
+	}
+	s.loadIndex()
+	s.loadMeta()
+
+	var err error
+	s.indexFd, err = os.OpenFile(blobIndexFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic(err)
+	}
+	s.metaFd, err = os.OpenFile(blobMetaFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *ContentAddressedStorage) loadIndex() {
+	f, err := os.Open(blobIndexFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		url, sum, ok := strings.Cut(scanner.Text(), "\t")
+		if ok {
+			s.index[url] = sum
+		}
+	}
+}
+
+func (s *ContentAddressedStorage) loadMeta() {
+	f, err := os.Open(blobMetaFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		sum, base, ok := strings.Cut(scanner.Text(), "\t")
+		if ok {
+			s.meta[sum] = base
+		}
+	}
+	// familyBase (which hash is the delta dictionary for a given act
+	// family) isn't persisted: it's only needed to pick a dictionary for
+	// newly-seen blobs, and re-deriving it fresh each run just means the
+	// first blob of a family re-seen this run becomes the new base.
+}
+
+func blobDir(sum string) string {
+	return filepath.Join(blobsDir, sum[:2])
+}
+
+func blobPath(sum string) string {
+	return filepath.Join(blobDir(sum), sum)
+}
+
+// familyKey groups URLs that are almost certainly translations/revisions of
+// the same act, so their blobs can share a delta dictionary: Fedlex ELI
+// URLs end in a two-letter language segment, which we strip.
+func familyKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) > 0 && len(segments[len(segments)-1]) == 2 {
+		segments = segments[:len(segments)-1]
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *ContentAddressedStorage) Save(rawURL string, body []byte, headers http.Header) error {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	_, blobExists := s.meta[hash]
+	if !blobExists {
+		if err := os.MkdirAll(blobDir(hash), 0755); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+
+		family := familyKey(rawURL)
+		baseHash, haveBase := s.familyBase[family]
+		if !*dedupeFlag || !haveBase || baseHash == hash {
+			if err := os.WriteFile(blobPath(hash), body, 0644); err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			s.meta[hash] = ""
+			fmt.Fprintf(s.metaFd, "%s\t\n", hash)
+		} else {
+			baseBody, err := os.ReadFile(blobPath(baseHash))
+			if err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			delta, err := encodeDelta(body, baseBody)
+			if err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			if err := os.WriteFile(blobPath(hash), delta, 0644); err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			s.meta[hash] = baseHash
+			fmt.Fprintf(s.metaFd, "%s\t%s\n", hash, baseHash)
+		}
+		if !haveBase {
+			s.familyBase[family] = hash
+		}
+	}
+	s.index[rawURL] = hash
+	fmt.Fprintf(s.indexFd, "%s\t%s\n", rawURL, hash)
+	s.mu.Unlock()
+
+	return s.linkMirrorPath(rawURL, hash)
+}
+
+// linkMirrorPath makes mirror/<path> a symlink into the blob store,
+// replacing whatever was there before (a stale regular file or symlink
+// from a pre-dedupe run).
+func (s *ContentAddressedStorage) linkMirrorPath(rawURL, hash string) error {
+	mirrorPath := urlToPath(rawURL)
+	if err := os.MkdirAll(filepath.Dir(mirrorPath), 0755); err != nil {
+		return err
+	}
+	os.Remove(mirrorPath)
+
+	target, err := filepath.Rel(filepath.Dir(mirrorPath), blobPath(hash))
+	if err != nil {
+		target = blobPath(hash)
+	}
+	return os.Symlink(target, mirrorPath)
+}
+
+func (s *ContentAddressedStorage) Exists(rawURL string) (bool, error) {
+	s.mu.Lock()
+	_, ok := s.index[rawURL]
+	s.mu.Unlock()
+	return ok, nil
+}
+
+func (s *ContentAddressedStorage) Open(rawURL string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	hash, ok := s.index[rawURL]
+	baseHash := s.meta[hash]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no blob indexed for %s", rawURL)
+	}
+
+	raw, err := os.ReadFile(blobPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	if baseHash == "" {
+		return io.NopCloser(bytes.NewReader(raw)), nil
+	}
+
+	baseBody, err := os.ReadFile(blobPath(baseHash))
+	if err != nil {
+		return nil, fmt.Errorf("reading delta base %s: %w", baseHash, err)
+	}
+	decoded, err := decodeDelta(raw, baseBody)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(decoded)), nil
+}
+
+// encodeDelta produces a small, self-contained delta of body against base:
+// the length of their common prefix and common suffix, plus whatever
+// differs in between, zstd-compressed. zstd's dictionary API needs a
+// dictionary in the trained "dictionary format" (see `zstd --train`); a
+// raw prior blob isn't one, so rather than misuse that API this just
+// diffs against the base directly.
+func encodeDelta(body, base []byte) ([]byte, error) {
+	prefixLen := commonPrefixLen(body, base)
+	maxSuffix := len(body) - prefixLen
+	if rem := len(base) - prefixLen; rem < maxSuffix {
+		maxSuffix = rem
+	}
+	suffixLen := commonSuffixLen(body[prefixLen:], base[prefixLen:], maxSuffix)
+	middle := body[prefixLen : len(body)-suffixLen]
+
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint64(header[0:8], uint64(prefixLen))
+	binary.BigEndian.PutUint64(header[8:16], uint64(suffixLen))
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+	return enc.EncodeAll(append(header, middle...), nil), nil
+}
+
+// decodeDelta reverses encodeDelta, reconstructing the original body from
+// base plus the encoded (prefixLen, suffixLen, middle) triple.
+func decodeDelta(encoded, base []byte) ([]byte, error) {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	raw, err := dec.DecodeAll(encoded, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 16 {
+		return nil, fmt.Errorf("delta payload too short: %d bytes", len(raw))
+	}
+
+	prefixLen := binary.BigEndian.Uint64(raw[0:8])
+	suffixLen := binary.BigEndian.Uint64(raw[8:16])
+	middle := raw[16:]
+	if prefixLen+suffixLen > uint64(len(base)) {
+		return nil, fmt.Errorf("delta prefix/suffix (%d/%d) longer than base (%d bytes)", prefixLen, suffixLen, len(base))
+	}
+
+	result := make([]byte, 0, int(prefixLen)+len(middle)+int(suffixLen))
+	result = append(result, base[:prefixLen]...)
+	result = append(result, middle...)
+	result = append(result, base[uint64(len(base))-suffixLen:]...)
+	return result, nil
+}
+
+func commonPrefixLen(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// commonSuffixLen returns how many trailing bytes a and b share, capped at
+// maxLen so the suffix scan never overlaps a prefix already accounted for.
+func commonSuffixLen(a, b []byte, maxLen int) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if maxLen < n {
+		n = maxLen
+	}
+	i := 0
+	for i < n && a[len(a)-1-i] == b[len(b)-1-i] {
+		i++
+	}
+	return i
+}
+
+// runVerify is the "mirror verify" subcommand: it walks blob-index.tsv,
+// reconstructs every blob (decoding deltas as needed) and confirms its
+// SHA256 matches what the index recorded.
+func runVerify() error {
+	s := newContentAddressedStorage()
+
+	var checked, mismatched int
+	for rawURL, hash := range s.index {
+		rc, err := s.Open(rawURL)
+		if err != nil {
+			fmt.Printf("MISSING %s (%s): %v\n", rawURL, hash, err)
+			mismatched++
+			continue
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			fmt.Printf("READ ERROR %s (%s): %v\n", rawURL, hash, err)
+			mismatched++
+			continue
+		}
+
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != hash {
+			fmt.Printf("CORRUPT %s: expected %s, got %x\n", rawURL, hash, sum)
+			mismatched++
+			continue
+		}
+		checked++
+	}
+
+	fmt.Printf("Verified %d blobs, %d mismatched/missing\n", checked, mismatched)
+	if mismatched > 0 {
+		return fmt.Errorf("%d blobs failed verification", mismatched)
+	}
+	return nil
+}
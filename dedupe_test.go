@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecodeDeltaRoundTrip(t *testing.T) {
+	base := []byte(strings.Repeat("Art. 1 Gegenstand dieses Gesetzes ist die Regelung von X. ", 20))
+	body := append(append([]byte{}, base[:100]...), append([]byte("EIN EINGEFUEGTER SATZ HIER."), base[200:]...)...)
+
+	delta, err := encodeDelta(body, base)
+	if err != nil {
+		t.Fatalf("encodeDelta: %v", err)
+	}
+
+	got, err := decodeDelta(delta, base)
+	if err != nil {
+		t.Fatalf("decodeDelta: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatalf("round trip mismatch: got %d bytes, want %d bytes", len(got), len(body))
+	}
+}
+
+// TestContentAddressedStorageFamilyDelta exercises the end-to-end -dedupe
+// path: the second document in an act family must be stored as a delta
+// against the first, and reading it back must reproduce the original bytes.
+func TestContentAddressedStorageFamilyDelta(t *testing.T) {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	prevDedupe := *dedupeFlag
+	*dedupeFlag = true
+	defer func() { *dedupeFlag = prevDedupe }()
+
+	s := newContentAddressedStorage()
+
+	base := []byte(strings.Repeat("Art. 1 Gegenstand dieses Gesetzes ist die Regelung von X. ", 20))
+	variant := append(append([]byte{}, base[:100]...), append([]byte("EIN EINGEFUEGTER SATZ HIER."), base[200:]...)...)
+
+	urlDE := "https://www.fedlex.admin.ch/eli/cc/2020/1/de"
+	urlFR := "https://www.fedlex.admin.ch/eli/cc/2020/1/fr"
+
+	if err := s.Save(urlDE, base, nil); err != nil {
+		t.Fatalf("Save base: %v", err)
+	}
+	if err := s.Save(urlFR, variant, nil); err != nil {
+		t.Fatalf("Save variant: %v", err)
+	}
+
+	s.mu.Lock()
+	hash := s.index[urlFR]
+	baseHash := s.meta[hash]
+	s.mu.Unlock()
+	if baseHash == "" {
+		t.Fatalf("expected %s to be stored as a delta against %s, got a raw blob", urlFR, urlDE)
+	}
+
+	rc, err := s.Open(urlFR)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading reconstructed body: %v", err)
+	}
+	if !bytes.Equal(got, variant) {
+		t.Fatalf("reconstructed body does not match original: got %d bytes, want %d bytes", len(got), len(variant))
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// digest is the in-memory crawl graph: the full URL->[targets] adjacency
+// map, per-URL fetch timestamps, and content hashes. It is the resumable
+// source of truth for a crawl, checkpointed to disk periodically instead
+// of appending every edge to edges.tsv on every run.
+type digest struct {
+	Edges   map[string][]string `json:"edges"`   // source -> deduped target list
+	Fetched map[string]int64    `json:"fetched"` // url -> unix fetch time
+	Hashes  map[string]string   `json:"hashes"`  // url -> content sha256
+}
+
+const (
+	digestFile             = "digest.json.snappy"
+	digestCheckpointPeriod = 30 * time.Second
+)
+
+var (
+	crawlDigest = &digest{
+		Edges:   make(map[string][]string),
+		Fetched: make(map[string]int64),
+		Hashes:  make(map[string]string),
+	}
+	digestMu sync.Mutex
+	// edgeSeen mirrors digest.Edges as a set for O(1) dedup checks instead
+	// of scanning the target slice on every insert.
+	edgeSeen = make(map[string]map[string]bool)
+)
+
+// loadDigest reads and decompresses digestFile written by a previous run,
+// rebuilding edgeSeen so re-crawled edges are deduped rather than
+// re-appended.
+func loadDigest() {
+	raw, err := os.ReadFile(digestFile)
+	if err != nil {
+		return // No digest yet, start fresh
+	}
+
+	decoded, err := snappy.Decode(nil, raw)
+	if err != nil {
+		fmt.Printf("Error decompressing digest: %v\n", err)
+		return
+	}
+
+	var d digest
+	if err := json.Unmarshal(decoded, &d); err != nil {
+		fmt.Printf("Error parsing digest: %v\n", err)
+		return
+	}
+
+	digestMu.Lock()
+	crawlDigest = &d
+	for source, targets := range d.Edges {
+		seen := make(map[string]bool, len(targets))
+		for _, t := range targets {
+			seen[t] = true
+		}
+		edgeSeen[source] = seen
+	}
+	digestMu.Unlock()
+
+	fmt.Printf("Loaded digest: %d URLs fetched, %d source nodes with edges\n", len(d.Fetched), len(d.Edges))
+}
+
+// addDigestEdge records source->target if it hasn't been seen before,
+// returning whether it was newly added.
+func addDigestEdge(source, target string) bool {
+	digestMu.Lock()
+	defer digestMu.Unlock()
+
+	if edgeSeen[source] == nil {
+		edgeSeen[source] = make(map[string]bool)
+	}
+	if edgeSeen[source][target] {
+		return false
+	}
+	edgeSeen[source][target] = true
+	crawlDigest.Edges[source] = append(crawlDigest.Edges[source], target)
+	return true
+}
+
+// recordDigestFetch stores the fetch time and content hash for url.
+func recordDigestFetch(url, sha256Hash string, fetchedAt time.Time) {
+	digestMu.Lock()
+	crawlDigest.Fetched[url] = fetchedAt.Unix()
+	if sha256Hash != "" {
+		crawlDigest.Hashes[url] = sha256Hash
+	}
+	digestMu.Unlock()
+}
+
+// checkpointDigest serializes the digest to JSON, snappy-compresses it,
+// and atomically replaces digestFile so a crash mid-write can't corrupt it.
+func checkpointDigest() {
+	digestMu.Lock()
+	encoded, err := json.Marshal(crawlDigest)
+	digestMu.Unlock()
+	if err != nil {
+		fmt.Printf("Error marshaling digest: %v\n", err)
+		return
+	}
+
+	compressed := snappy.Encode(nil, encoded)
+
+	tmp := digestFile + ".tmp"
+	if err := os.WriteFile(tmp, compressed, 0644); err != nil {
+		fmt.Printf("Error writing digest checkpoint: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, digestFile); err != nil {
+		fmt.Printf("Error committing digest checkpoint: %v\n", err)
+	}
+}
+
+// startDigestCheckpointer flushes the digest every digestCheckpointPeriod
+// and once more on SIGINT, so a killed crawl loses at most one interval's
+// worth of progress. It calls os.Exit itself on interrupt, since the main
+// goroutine is blocked in c.Wait().
+func startDigestCheckpointer() {
+	ticker := time.NewTicker(digestCheckpointPeriod)
+	go func() {
+		for range ticker.C {
+			checkpointDigest()
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		<-sigCh
+		fmt.Println("\nInterrupted, checkpointing digest...")
+		checkpointDigest()
+		os.Exit(130)
+	}()
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,10 +17,15 @@ import (
 	"github.com/gocolly/colly/v2"
 )
 
+// legacyTSV selects the original append-only edges.tsv/progress.txt export
+// instead of (in addition to) the snappy-compressed digest checkpoint.
+var legacyTSV = flag.Bool("legacy-tsv", false, "also export edges.tsv and progress.txt alongside digest.json.snappy")
+
 type Sitemap struct {
 	XMLName xml.Name `xml:"urlset"`
 	URLs    []struct {
-		Loc string `xml:"loc"`
+		Loc     string `xml:"loc"`
+		Lastmod string `xml:"lastmod"`
 	} `xml:"url"`
 }
 
@@ -30,6 +36,13 @@ type SitemapIndex struct {
 	} `xml:"sitemap"`
 }
 
+// SitemapURL is a single <url> entry surviving sitemap parsing, including
+// its <lastmod> so callers can decide whether a re-fetch is warranted.
+type SitemapURL struct {
+	Loc     string
+	Lastmod time.Time // zero value if the sitemap omitted or mis-formatted lastmod
+}
+
 const (
 	progressFile = "progress.txt"
 	urlsFile     = "urls.txt"
@@ -37,89 +50,186 @@ const (
 )
 
 var (
-	completed     = make(map[string]bool)
-	completedMu   sync.RWMutex
-	savedCount    int64
-	edgeCount     int64
-	progressFd    *os.File
-	edgesFd       *os.File
-	edgesMu       sync.Mutex
+	completed   = make(map[string]bool)
+	completedMu sync.RWMutex
+	savedCount  int64
+	edgeCount   int64
+	progressFd  *os.File
+	edgesFd     *os.File
+	edgesMu     sync.Mutex
 )
 
 func main() {
-	// Load completed URLs from progress file
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		if err := runVerify(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	flag.Parse()
+
+	if *extractCitationsFlag {
+		if err := runCitationExtraction(); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// Fetch and cache robots.txt before enqueuing anything
+	robots := fetchRobots(robotsURL)
+	extraSitemapURLs = robots.sitemaps
+
+	// Load completed URLs from progress file (legacy export, if present)
 	loadProgress()
 
+	// Load per-URL ETag/Last-Modified/SHA256 from the previous run
+	loadMetadata()
+
+	// Load the checkpointed crawl digest: fetched URLs and deduped edges
+	loadDigest()
+	for url := range crawlDigest.Fetched {
+		completed[url] = true
+	}
+
 	// Get all URLs (from cache or fetch)
 	allURLs := getAllURLs()
 
-	// Filter out completed
+	store := newStorage()
+
+	// metadata.tsv/digest.json.snappy live next to the local mirror, so a
+	// local backend's completed state is trustworthy on its own. A networked
+	// backend (e.g. -storage=http pointed at a different machine's bucket)
+	// has no such guarantee, so double-check the page actually made it to
+	// storage before trusting "completed" and skipping it.
+	verifyRemoteExistence := storageKind(*storageFlag) == storageHTTP
+
+	// Filter out completed and sitemap-unchanged URLs
 	var pending []string
+	skippedCurrent := 0
 	for _, url := range allURLs {
 		completedMu.RLock()
-		done := completed[url]
+		done := completed[url.Loc]
 		completedMu.RUnlock()
-		if !done {
-			pending = append(pending, url)
+		if done {
+			if !verifyRemoteExistence {
+				continue
+			}
+			if exists, err := store.Exists(url.Loc); err == nil && exists {
+				continue
+			}
+			fmt.Printf("Marked completed but missing from storage, re-fetching: %s\n", url.Loc)
+		}
+		if stillCurrent(url.Loc, url.Lastmod) {
+			skippedCurrent++
+			continue
+		}
+		if !robotsAllow(robots, url.Loc) {
+			continue
 		}
+		pending = append(pending, url.Loc)
 	}
 
-	fmt.Printf("Total URLs: %d, Already done: %d, Pending: %d\n", len(allURLs), len(completed), len(pending))
+	fmt.Printf("Total URLs: %d, Already done: %d, Unchanged per sitemap: %d, Pending: %d\n",
+		len(allURLs), len(completed), skippedCurrent, len(pending))
 
 	if len(pending) == 0 {
 		fmt.Println("All URLs already downloaded!")
 		return
 	}
 
-	// Open progress file for appending
-	var err error
-	progressFd, err = os.OpenFile(progressFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		panic(err)
-	}
-	defer progressFd.Close()
+	// In legacy mode, also open the append-only TSV exports
+	if *legacyTSV {
+		var err error
+		progressFd, err = os.OpenFile(progressFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			panic(err)
+		}
+		defer progressFd.Close()
 
-	// Open edges file for appending (TSV: source \t target)
-	edgesFd, err = os.OpenFile(edgesFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		panic(err)
+		edgesFd, err = os.OpenFile(edgesFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			panic(err)
+		}
+		defer edgesFd.Close()
 	}
-	defer edgesFd.Close()
 
-	// Create collector with higher parallelism
+	// Checkpoint the digest periodically and on interrupt
+	startDigestCheckpointer()
+
+	limiter := newAdaptiveLimiter(robots.crawlDelay)
+
+	// Create collector; request pacing is handled by limiter instead of a
+	// fixed colly.LimitRule so it can back off and ramp up adaptively.
 	c := colly.NewCollector(
 		colly.AllowedDomains("www.fedlex.admin.ch", "fedlex.admin.ch"),
 		colly.Async(true),
 	)
 
-	c.Limit(&colly.LimitRule{
-		DomainGlob:  "*",
-		Delay:       20 * time.Millisecond,
-		Parallelism: 100,
+	c.OnRequest(func(r *colly.Request) {
+		limiter.acquire()
+		if m, ok := metaFor(r.URL.String()); ok {
+			if m.ETag != "" {
+				r.Headers.Set("If-None-Match", m.ETag)
+			}
+			if m.LastModified != "" {
+				r.Headers.Set("If-Modified-Since", m.LastModified)
+			}
+		}
 	})
 
 	c.OnResponse(func(r *colly.Response) {
 		url := r.Request.URL.String()
-		savePath := urlToPath(url)
-		os.MkdirAll(filepath.Dir(savePath), 0755)
-		r.Save(savePath)
+		limiter.release()
+		limiter.onSuccess()
+
+		if r.StatusCode == http.StatusNotModified {
+			// Server confirmed our cached copy is current: don't touch the
+			// mirror file, just refresh the fetch time for next time.
+			touchFetch(url)
+			if m, ok := metaFor(url); ok {
+				recordDigestFetch(url, m.SHA256, time.Now())
+			}
+			completedMu.Lock()
+			completed[url] = true
+			if *legacyTSV {
+				progressFd.WriteString(url + "\n")
+			}
+			completedMu.Unlock()
+			atomic.AddInt64(&savedCount, 1)
+			return
+		}
+
+		if err := store.Save(url, r.Body, *r.Headers); err != nil {
+			fmt.Printf("Error saving %s: %v\n", url, err)
+			return
+		}
+		recordFetch(url, r.Headers.Get("ETag"), r.Headers.Get("Last-Modified"), r.Body)
+		if m, ok := metaFor(url); ok {
+			recordDigestFetch(url, m.SHA256, m.FetchedAt)
+		}
 
 		// Mark as done
 		completedMu.Lock()
 		completed[url] = true
-		progressFd.WriteString(url + "\n")
+		if *legacyTSV {
+			progressFd.WriteString(url + "\n")
+		}
 		completedMu.Unlock()
 
 		count := atomic.AddInt64(&savedCount, 1)
 		if count%100 == 0 {
-			fmt.Printf("Progress: %d/%d (%.2f%%)\n", count, len(pending), float64(count)/float64(len(pending))*100)
+			parallelism, delay := limiter.rate()
+			fmt.Printf("Progress: %d/%d (%.2f%%) [rate: parallelism=%d delay=%v]\n",
+				count, len(pending), float64(count)/float64(len(pending))*100, parallelism, delay)
 		}
 	})
 
 	c.OnError(func(r *colly.Response, err error) {
-		if r.StatusCode == 429 {
-			fmt.Printf("Rate limited! Slowing down...\n")
-			time.Sleep(5 * time.Second)
+		limiter.release()
+		if r.StatusCode == 429 || r.StatusCode == 503 {
+			limiter.onThrottled()
 			r.Request.Retry()
 		} else {
 			fmt.Printf("Error %d: %s\n", r.StatusCode, r.Request.URL)
@@ -132,12 +242,16 @@ func main() {
 		link := e.Attr("href")
 		targetURL := e.Request.AbsoluteURL(link)
 
-		// Only record edges within the domain
+		// Only record edges within the domain, deduped against the digest
 		if strings.Contains(targetURL, "fedlex.admin.ch") && targetURL != "" && targetURL != sourceURL {
-			edgesMu.Lock()
-			edgesFd.WriteString(sourceURL + "\t" + targetURL + "\n")
-			atomic.AddInt64(&edgeCount, 1)
-			edgesMu.Unlock()
+			if addDigestEdge(sourceURL, targetURL) {
+				atomic.AddInt64(&edgeCount, 1)
+				if *legacyTSV {
+					edgesMu.Lock()
+					edgesFd.WriteString(sourceURL + "\t" + targetURL + "\n")
+					edgesMu.Unlock()
+				}
+			}
 		}
 
 		// Follow PDF/XML links
@@ -153,6 +267,8 @@ func main() {
 	}
 
 	c.Wait()
+	saveMetadata()
+	checkpointDigest()
 
 	elapsed := time.Since(start)
 	fmt.Printf("\nDone! Downloaded %d pages, recorded %d edges in %v (%.1f pages/sec)\n",
@@ -173,12 +289,26 @@ func loadProgress() {
 	fmt.Printf("Loaded %d completed URLs from progress file\n", len(completed))
 }
 
-func getAllURLs() []string {
-	// Try to load from cache
-	if urls := loadURLsCache(); len(urls) > 0 {
-		return urls
+// getAllURLs always re-parses the sitemaps so Lastmod reflects what Fedlex
+// currently advertises (stillCurrent's incremental-fetch decision depends on
+// that being fresh every run, not frozen at whatever the first crawl saw).
+// urls.txt is only consulted as a fallback when the network fetch comes back
+// empty, e.g. because fedlex.admin.ch is unreachable.
+func getAllURLs() []SitemapURL {
+	uniqueURLs := fetchAllURLsFromSitemaps()
+	if len(uniqueURLs) == 0 {
+		fmt.Println("Sitemap fetch returned nothing, falling back to urls.txt cache")
+		return loadURLsCache()
 	}
 
+	saveURLsCache(uniqueURLs)
+	return uniqueURLs
+}
+
+// fetchAllURLsFromSitemaps downloads and parses every known sitemap
+// (including any extraSitemapURLs discovered in robots.txt) and returns the
+// deduplicated union. It returns nil if nothing could be fetched.
+func fetchAllURLsFromSitemaps() []SitemapURL {
 	fmt.Println("Fetching sitemaps...")
 	sitemapURLs := []string{
 		"https://www.fedlex.admin.ch/sitemap-index.xml",
@@ -223,8 +353,9 @@ func getAllURLs() []string {
 		"https://www.fedlex.admin.ch/sitemap-cc1-1.xml",
 		"https://www.fedlex.admin.ch/sitemap-cc1-2.xml",
 	}
+	sitemapURLs = append(sitemapURLs, extraSitemapURLs...)
 
-	var allPageURLs []string
+	var allPageURLs []SitemapURL
 	for _, sitemapURL := range sitemapURLs {
 		fmt.Printf("Parsing: %s\n", sitemapURL)
 		urls := parseSitemap(sitemapURL)
@@ -233,46 +364,57 @@ func getAllURLs() []string {
 
 	// Deduplicate
 	seen := make(map[string]bool)
-	var uniqueURLs []string
+	var uniqueURLs []SitemapURL
 	for _, url := range allPageURLs {
-		if !seen[url] {
-			seen[url] = true
+		if !seen[url.Loc] {
+			seen[url.Loc] = true
 			uniqueURLs = append(uniqueURLs, url)
 		}
 	}
 
-	// Cache URLs
-	saveURLsCache(uniqueURLs)
-
 	return uniqueURLs
 }
 
-func loadURLsCache() []string {
+// urlsCacheSep separates the URL from its sitemap lastmod in urls.txt. Tab
+// is safe since neither field can contain one.
+const urlsCacheSep = "\t"
+
+func loadURLsCache() []SitemapURL {
 	f, err := os.Open(urlsFile)
 	if err != nil {
 		return nil
 	}
 	defer f.Close()
 
-	var urls []string
+	var urls []SitemapURL
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		urls = append(urls, scanner.Text())
+		line := scanner.Text()
+		loc, lastmodRaw, _ := strings.Cut(line, urlsCacheSep)
+		var lastmod time.Time
+		if lastmodRaw != "" {
+			lastmod, _ = time.Parse(time.RFC3339, lastmodRaw)
+		}
+		urls = append(urls, SitemapURL{Loc: loc, Lastmod: lastmod})
 	}
 	fmt.Printf("Loaded %d URLs from cache\n", len(urls))
 	return urls
 }
 
-func saveURLsCache(urls []string) {
+func saveURLsCache(urls []SitemapURL) {
 	f, _ := os.Create(urlsFile)
 	defer f.Close()
 	for _, url := range urls {
-		f.WriteString(url + "\n")
+		lastmodRaw := ""
+		if !url.Lastmod.IsZero() {
+			lastmodRaw = url.Lastmod.Format(time.RFC3339)
+		}
+		f.WriteString(url.Loc + urlsCacheSep + lastmodRaw + "\n")
 	}
 	fmt.Printf("Cached %d URLs\n", len(urls))
 }
 
-func parseSitemap(url string) []string {
+func parseSitemap(url string) []SitemapURL {
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Get(url)
 	if err != nil {
@@ -290,7 +432,7 @@ func parseSitemap(url string) []string {
 	// Try as sitemap index first
 	var index SitemapIndex
 	if xml.Unmarshal(body, &index) == nil && len(index.Sitemaps) > 0 {
-		var urls []string
+		var urls []SitemapURL
 		for _, s := range index.Sitemaps {
 			urls = append(urls, parseSitemap(s.Loc)...)
 		}
@@ -304,14 +446,29 @@ func parseSitemap(url string) []string {
 		return nil
 	}
 
-	var urls []string
+	urls := make([]SitemapURL, 0, len(sitemap.URLs))
 	for _, u := range sitemap.URLs {
-		urls = append(urls, u.Loc)
+		urls = append(urls, SitemapURL{Loc: u.Loc, Lastmod: parseLastmod(u.Lastmod)})
 	}
 	fmt.Printf("  -> Found %d URLs\n", len(urls))
 	return urls
 }
 
+// parseLastmod accepts the handful of timestamp layouts Fedlex's sitemaps
+// actually use (full RFC3339, and the date-only form) and returns the zero
+// time.Time if none match, which callers treat as "unknown, always fetch".
+func parseLastmod(raw string) time.Time {
+	if raw == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
 func urlToPath(urlStr string) string {
 	path := strings.TrimPrefix(urlStr, "https://")
 	path = strings.TrimPrefix(path, "http://")
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// urlMeta is the per-URL state that lets a subsequent run skip unchanged
+// pages and issue conditional GETs for the rest.
+type urlMeta struct {
+	ETag         string
+	LastModified string
+	SHA256       string
+	FetchedAt    time.Time
+}
+
+const metadataFile = "metadata.tsv"
+
+var (
+	metadata   = make(map[string]*urlMeta)
+	metadataMu sync.RWMutex
+)
+
+// loadMetadata populates the in-memory metadata map from the sidecar file
+// written by a previous run. Missing or unreadable files just mean every
+// URL is treated as never-fetched.
+func loadMetadata() {
+	f, err := os.Open(metadataFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 5 {
+			continue
+		}
+		fetchedUnix, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			continue
+		}
+		metadata[fields[0]] = &urlMeta{
+			ETag:         fields[1],
+			LastModified: fields[2],
+			SHA256:       fields[3],
+			FetchedAt:    time.Unix(fetchedUnix, 0),
+		}
+	}
+	fmt.Printf("Loaded metadata for %d URLs\n", len(metadata))
+}
+
+// saveMetadata rewrites metadataFile from the in-memory map. Unlike
+// progress.txt this isn't append-only: entries get updated in place as
+// pages are re-validated, so a full rewrite is simplest.
+func saveMetadata() {
+	metadataMu.RLock()
+	defer metadataMu.RUnlock()
+
+	f, err := os.Create(metadataFile)
+	if err != nil {
+		fmt.Printf("Error writing metadata file: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	defer w.Flush()
+	for url, m := range metadata {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", url, m.ETag, m.LastModified, m.SHA256, m.FetchedAt.Unix())
+	}
+}
+
+// recordFetch stores or updates the metadata for url after a successful
+// (non-304) fetch.
+func recordFetch(url, etag, lastModified string, body []byte) {
+	sum := sha256.Sum256(body)
+	metadataMu.Lock()
+	metadata[url] = &urlMeta{
+		ETag:         etag,
+		LastModified: lastModified,
+		SHA256:       hex.EncodeToString(sum[:]),
+		FetchedAt:    time.Now(),
+	}
+	metadataMu.Unlock()
+}
+
+// touchFetch bumps FetchedAt for a URL that came back 304 Not Modified,
+// without disturbing the stored ETag/Last-Modified/SHA256.
+func touchFetch(url string) {
+	metadataMu.Lock()
+	if m, ok := metadata[url]; ok {
+		m.FetchedAt = time.Now()
+	}
+	metadataMu.Unlock()
+}
+
+func metaFor(url string) (*urlMeta, bool) {
+	metadataMu.RLock()
+	defer metadataMu.RUnlock()
+	m, ok := metadata[url]
+	return m, ok
+}
+
+// stillCurrent reports whether the sitemap's lastmod for url is no newer
+// than the last time we actually fetched it, meaning the crawl can skip it
+// entirely instead of even issuing a conditional request.
+func stillCurrent(url string, lastmod time.Time) bool {
+	if lastmod.IsZero() {
+		return false
+	}
+	m, ok := metaFor(url)
+	if !ok {
+		return false
+	}
+	return !lastmod.After(m.FetchedAt)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// extraSitemapURLs holds sitemaps discovered in robots.txt, merged into
+// the hard-coded list in getAllURLs.
+var extraSitemapURLs []string
+
+// robotsAllow reports whether rawURL's path may be fetched per rules.
+func robotsAllow(rules *robotsRules, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+	return rules.allows(u.Path)
+}
+
+const (
+	robotsURL        = "https://www.fedlex.admin.ch/robots.txt"
+	crawlerUserAgent = "*" // colly's default User-Agent group in robots.txt terms
+
+	initialParallelism = 100
+	maxParallelism     = 100
+	initialDelay       = 20 * time.Millisecond
+	maxDelay           = 60 * time.Second // ceiling so sustained throttling can still recover
+	rampWindow         = 200              // consecutive 2xx responses before ramping parallelism back up
+)
+
+// robotsRules holds the subset of robots.txt that matters for a polite
+// crawl: disallowed path prefixes for our user-agent, the crawl-delay
+// floor, and any sitemaps it advertises.
+type robotsRules struct {
+	disallow   []string
+	crawlDelay time.Duration
+	sitemaps   []string
+}
+
+// allows reports whether path may be fetched under the parsed rules.
+func (r *robotsRules) allows(path string) bool {
+	for _, prefix := range r.disallow {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchRobots downloads and parses robots.txt, matching the "*" user-agent
+// group (colly doesn't send a distinguishing one). A fetch failure yields
+// empty rules rather than blocking the crawl.
+func fetchRobots(url string) *robotsRules {
+	rules := &robotsRules{}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Printf("Error fetching robots.txt: %v\n", err)
+		return rules
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rules
+	}
+
+	inOurGroup := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			inOurGroup = value == "*" || strings.EqualFold(value, crawlerUserAgent)
+		case "disallow":
+			if inOurGroup && value != "" {
+				rules.disallow = append(rules.disallow, value)
+			}
+		case "crawl-delay":
+			if inOurGroup {
+				if secs, err := strconv.ParseFloat(value, 64); err == nil {
+					rules.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			if value != "" {
+				rules.sitemaps = append(rules.sitemaps, value)
+			}
+		}
+	}
+
+	fmt.Printf("robots.txt: %d disallow rules, crawl-delay=%v, %d extra sitemaps\n",
+		len(rules.disallow), rules.crawlDelay, len(rules.sitemaps))
+	return rules
+}
+
+// adaptiveLimiter replaces colly's fixed Delay/Parallelism LimitRule with a
+// controller that backs off on 429/503 and slowly ramps back up, with the
+// robots.txt crawl-delay enforced as a floor. All fields are guarded by mu;
+// none are accessed via sync/atomic, since mixing the two on the same field
+// is a data race in itself.
+type adaptiveLimiter struct {
+	mu          sync.Mutex
+	delay       time.Duration
+	minDelay    time.Duration
+	parallelism int
+	maxParallel int
+
+	active        int
+	consecutiveOK int
+}
+
+func newAdaptiveLimiter(minDelay time.Duration) *adaptiveLimiter {
+	delay := initialDelay
+	if minDelay > delay {
+		delay = minDelay
+	}
+	return &adaptiveLimiter{
+		delay:       delay,
+		minDelay:    minDelay,
+		parallelism: initialParallelism,
+		maxParallel: maxParallelism,
+	}
+}
+
+// acquire blocks until a request slot is free and the current delay has
+// elapsed, then marks the slot in use.
+func (l *adaptiveLimiter) acquire() {
+	for {
+		l.mu.Lock()
+		if l.active < l.parallelism {
+			l.active++
+			delay := l.delay
+			l.mu.Unlock()
+			time.Sleep(delay)
+			return
+		}
+		l.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+}
+
+// onThrottled reacts to a 429/503 by halving parallelism and doubling the
+// delay, capped at maxDelay (and never below the robots.txt crawl-delay
+// floor) so sustained throttling can't push the delay out so far that the
+// crawl never sees rampWindow consecutive successes to recover from.
+func (l *adaptiveLimiter) onThrottled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.parallelism > 1 {
+		l.parallelism /= 2
+	}
+	l.delay *= 2
+	if l.delay > maxDelay {
+		l.delay = maxDelay
+	}
+	if l.delay < l.minDelay {
+		l.delay = l.minDelay
+	}
+	l.consecutiveOK = 0
+	fmt.Printf("Rate limited! Backing off to parallelism=%d delay=%v\n", l.parallelism, l.delay)
+}
+
+// onSuccess ramps parallelism back up by one step after rampWindow
+// consecutive 2xx responses, so a cautious backoff doesn't stay cautious
+// forever.
+func (l *adaptiveLimiter) onSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.consecutiveOK++
+	if l.consecutiveOK < rampWindow {
+		return
+	}
+	l.consecutiveOK = 0
+
+	if l.parallelism < l.maxParallel {
+		l.parallelism++
+	}
+	if l.delay > l.minDelay {
+		l.delay -= l.delay / 10
+		if l.delay < l.minDelay {
+			l.delay = l.minDelay
+		}
+	}
+}
+
+// rate returns the current effective parallelism and delay for logging.
+func (l *adaptiveLimiter) rate() (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.parallelism, l.delay
+}
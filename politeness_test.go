@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchRobots(t *testing.T) {
+	const body = `# comment lines and blanks should be ignored
+
+User-agent: Googlebot
+Disallow: /googlebot-only/
+
+User-agent: *
+Disallow: /private/
+Disallow: /also-private/
+Crawl-delay: 2.5
+Sitemap: https://www.fedlex.admin.ch/extra-sitemap.xml
+`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	rules := fetchRobots(ts.URL)
+
+	wantDisallow := []string{"/private/", "/also-private/"}
+	if len(rules.disallow) != len(wantDisallow) {
+		t.Fatalf("disallow = %v, want %v", rules.disallow, wantDisallow)
+	}
+	for i, d := range wantDisallow {
+		if rules.disallow[i] != d {
+			t.Errorf("disallow[%d] = %q, want %q", i, rules.disallow[i], d)
+		}
+	}
+	if rules.crawlDelay != 2500*time.Millisecond {
+		t.Errorf("crawlDelay = %v, want 2.5s", rules.crawlDelay)
+	}
+	if len(rules.sitemaps) != 1 || rules.sitemaps[0] != "https://www.fedlex.admin.ch/extra-sitemap.xml" {
+		t.Errorf("sitemaps = %v, want the one Sitemap: line", rules.sitemaps)
+	}
+	if rules.allows("/private/doc.xml") {
+		t.Error("expected /private/doc.xml to be disallowed")
+	}
+	if !rules.allows("/eli/cc/2020/1/de") {
+		t.Error("expected an unrelated path to be allowed")
+	}
+}
+
+func TestFetchRobotsFetchFailure(t *testing.T) {
+	rules := fetchRobots("http://127.0.0.1:0/robots.txt")
+	if len(rules.disallow) != 0 || len(rules.sitemaps) != 0 {
+		t.Errorf("expected empty rules on fetch failure, got %+v", rules)
+	}
+}
+
+func TestAdaptiveLimiterOnThrottledHalvesAndCaps(t *testing.T) {
+	l := newAdaptiveLimiter(0)
+	l.parallelism = 8
+
+	l.onThrottled()
+	if l.parallelism != 4 {
+		t.Errorf("parallelism = %d, want 4", l.parallelism)
+	}
+	if l.delay != 2*initialDelay {
+		t.Errorf("delay = %v, want %v", l.delay, 2*initialDelay)
+	}
+
+	// Keep throttling; delay must never exceed maxDelay.
+	for i := 0; i < 40; i++ {
+		l.onThrottled()
+	}
+	if l.delay > maxDelay {
+		t.Errorf("delay = %v, exceeds maxDelay %v", l.delay, maxDelay)
+	}
+	if l.parallelism < 1 {
+		t.Errorf("parallelism = %d, must never drop below 1", l.parallelism)
+	}
+}
+
+func TestAdaptiveLimiterOnSuccessRampsUpAfterWindow(t *testing.T) {
+	l := newAdaptiveLimiter(0)
+	l.parallelism = 4
+	l.delay = 10 * time.Second
+
+	for i := 0; i < rampWindow-1; i++ {
+		l.onSuccess()
+	}
+	if l.parallelism != 4 {
+		t.Fatalf("parallelism ramped up before rampWindow successes: %d", l.parallelism)
+	}
+
+	l.onSuccess()
+	if l.parallelism != 5 {
+		t.Errorf("parallelism = %d, want 5 after rampWindow successes", l.parallelism)
+	}
+	if l.delay >= 10*time.Second {
+		t.Errorf("delay = %v, expected it to ease down after ramping", l.delay)
+	}
+}
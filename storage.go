@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage abstracts where mirrored pages end up, so a crawl can target a
+// single local disk or a networked backend without touching the collector
+// logic. All methods key off the original page URL, not a backend-specific
+// path.
+type Storage interface {
+	Save(url string, body []byte, headers http.Header) error
+	Exists(url string) (bool, error)
+	Open(url string) (io.ReadCloser, error)
+}
+
+// storageKind names a -storage flag value.
+type storageKind string
+
+const (
+	storageLocal storageKind = "local"
+	storageHTTP  storageKind = "http"
+)
+
+var (
+	storageFlag    = flag.String("storage", string(storageLocal), "storage backend: local or http")
+	storageHTTPURL = flag.String("storage-http-base", "", "base URL of the HTTP PUT/GET storage backend (required when -storage=http)")
+)
+
+// newStorage builds the Storage backend selected by -storage (and -dedupe).
+func newStorage() Storage {
+	switch storageKind(*storageFlag) {
+	case storageHTTP:
+		if *storageHTTPURL == "" {
+			panic("-storage=http requires -storage-http-base")
+		}
+		return &HTTPStorage{BaseURL: *storageHTTPURL, Client: &http.Client{}}
+	case storageLocal, "":
+		if *dedupeFlag {
+			return newContentAddressedStorage()
+		}
+		return &LocalStorage{}
+	default:
+		panic(fmt.Sprintf("unknown -storage backend %q", *storageFlag))
+	}
+}
+
+// LocalStorage is the default backend: it writes into the mirror/ tree
+// exactly as the crawler always has, keyed by urlToPath.
+type LocalStorage struct{}
+
+func (LocalStorage) Save(url string, body []byte, headers http.Header) error {
+	path := urlToPath(url)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, body, 0644)
+}
+
+func (LocalStorage) Exists(url string) (bool, error) {
+	_, err := os.Stat(urlToPath(url))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (LocalStorage) Open(url string) (io.ReadCloser, error) {
+	return os.Open(urlToPath(url))
+}
+
+// HTTPStorage backs the mirror onto any server speaking plain HTTP
+// PUT/HEAD/GET against BaseURL+urlToPath(url), which is enough to point a
+// crawl at an S3-compatible bucket sitting behind an HTTP gateway, or any
+// other networked blob store, without pulling in a backend-specific SDK.
+type HTTPStorage struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (s *HTTPStorage) objectURL(url string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + urlToPath(url)
+}
+
+func (s *HTTPStorage) Save(url string, body []byte, headers http.Header) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(url), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("storage PUT %s: unexpected status %d", req.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *HTTPStorage) Exists(url string) (bool, error) {
+	resp, err := s.Client.Head(s.objectURL(url))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+func (s *HTTPStorage) Open(url string) (io.ReadCloser, error) {
+	resp, err := s.Client.Get(s.objectURL(url))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("storage GET %s: unexpected status %d", s.objectURL(url), resp.StatusCode)
+	}
+	return resp.Body, nil
+}